@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/dradtke/wetsuit/config"
+	"github.com/fsnotify/fsnotify"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// configReloadDebounce is how long we wait after the last filesystem event
+// before re-parsing mopidy.conf, so that editors which write through a
+// temp-file-then-rename don't trigger several reloads for one save.
+const configReloadDebounce = 250 * time.Millisecond
+
+// WatchConfig() starts watching the directory containing app.ConfigPath for
+// changes to it. fsnotify can't watch the file itself reliably, since most
+// editors save by renaming a temp file over it, so we watch the parent
+// directory and filter events down to the one file we care about. The
+// watcher is closed when app.Ctx is cancelled.
+func (app *Application) WatchConfig() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(app.ConfigPath)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go app.watchConfigEvents(watcher)
+	go func() {
+		<-app.Ctx.Done()
+		watcher.Close()
+	}()
+	return nil
+}
+
+// watchConfigEvents() drains watcher.Events until a debounced, settled
+// change to mopidy.conf is observed, then reloads it.
+func (app *Application) watchConfigEvents(watcher *fsnotify.Watcher) {
+	var debounce *time.Timer
+	var debounceC <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Base(event.Name) != filepath.Base(app.ConfigPath) {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if debounce == nil {
+				debounce = time.NewTimer(configReloadDebounce)
+			} else {
+				// Stop-and-drain before Reset, per the time.Timer docs:
+				// otherwise a tick already queued from the previous round
+				// can slip through the next select and fire early.
+				if !debounce.Stop() {
+					select {
+					case <-debounce.C:
+					default:
+					}
+				}
+				debounce.Reset(configReloadDebounce)
+			}
+			debounceC = debounce.C
+
+		case <-debounceC:
+			debounceC = nil
+			app.reloadConfigFile()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			app.Errors <- err
+		}
+	}
+}
+
+// reloadConfigFile() re-parses mopidy.conf and either swaps it in silently,
+// if nothing actually changed, or adopts it and prompts for a mopidy restart
+// to pick it up.
+func (app *Application) reloadConfigFile() {
+	next, err := config.Load(app.ConfigPath)
+	if err != nil {
+		app.Errors <- err
+		return
+	}
+
+	app.StatusLock.Lock()
+	prev := app.Config
+	app.Config = next
+	app.StatusLock.Unlock()
+
+	if reflect.DeepEqual(prev, next) {
+		return
+	}
+
+	app.waitForFrontend()
+	app.Frontend.PromptRestart("mopidy.conf changed on disk.", app.RestartMopidyCallback)
+}
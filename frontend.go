@@ -0,0 +1,30 @@
+package main
+
+import "io"
+
+// Frontend is the callback surface a UI implementation must provide to drive
+// Application's state machine. gtkFrontend (over the gui package) and
+// tuiFrontend (over the tui package) each implement it independently, so
+// Application never imports either package directly.
+type Frontend interface {
+	// RunOnUIThread schedules fn to run on the frontend's UI thread.
+	RunOnUIThread(fn func())
+
+	// OutputWriter returns a writer that mopidy's stdout/stderr should be
+	// copied to, or nil if the frontend surfaces process output some other
+	// way.
+	OutputWriter() io.Writer
+
+	// SetStatus reflects a mopidy status transition in the UI.
+	SetStatus(status MopidyStatus)
+
+	// ShowError surfaces a non-fatal error to the user.
+	ShowError(err error)
+
+	// PromptRestart offers to run onRestart in response to a condition
+	// described by message, without interrupting what the user is doing.
+	PromptRestart(message string, onRestart func())
+
+	// Quit tears down the frontend's UI and stops its event loop.
+	Quit()
+}
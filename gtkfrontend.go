@@ -0,0 +1,195 @@
+package main
+
+import (
+	"github.com/dradtke/gotk3/gio"
+	"github.com/dradtke/gotk3/glib"
+	"github.com/dradtke/gotk3/gtk"
+	"github.com/dradtke/wetsuit/gui"
+	"io"
+	"os"
+	"os/signal"
+)
+
+// AppID is wetsuit's DBus-activatable application ID. It's what gives us
+// single-instance behavior and lets the GNOME shell associate a running
+// wetsuit with its app menu.
+const AppID = "com.github.dradtke.wetsuit"
+
+// gtkFrontend implements Frontend on top of a GTK window, and is what
+// Application talks to once runGTK has built one.
+type gtkFrontend struct {
+	app          *Application
+	gtkApp       *gtk.Application
+	gui          *gui.Gui
+	showingError bool
+}
+
+// runGTK() builds a gtk.Application, wires it up to app, and blocks for the
+// lifetime of the process.
+func runGTK(app *Application) {
+	gtkApp, err := gtk.ApplicationNew(AppID, gio.APPLICATION_HANDLES_OPEN)
+	if err != nil {
+		fatal(err)
+	}
+
+	front := &gtkFrontend{app: app, gtkApp: gtkApp}
+
+	gtkApp.Connect("activate", func() { front.activate() })
+	gtkApp.Connect("open", func() { front.activate() })
+
+	os.Exit(gtkApp.Run(os.Args))
+}
+
+// activate() is run the first time wetsuit is launched, or when DBus
+// activation raises an already-running instance; GtkApplication delivers
+// "activate" to the primary instance on every subsequent `wetsuit` launch
+// too, so a window already being up means this is one of those and we just
+// present it instead of bootstrapping a second mopidy.
+func (f *gtkFrontend) activate() {
+	if f.gui != nil {
+		f.gui.MainWindow.Present()
+		return
+	}
+
+	f.app.SetFrontend(f)
+
+	mopidyCmdPath, err := f.app.bootstrap()
+	if err != nil {
+		fatal(err)
+	}
+
+	f.gui, err = gui.Init(f.gtkApp, f.app.Config)
+	if err != nil {
+		fatal(err)
+	}
+
+	f.registerActions()
+	f.gui.MainWindow.Connect("destroy", f.app.QuitCallback)
+	f.gui.OutputWindow.Connect("delete-event", f.app.OutputWindowDeleteCallback)
+
+	f.gui.MainWindow.ShowAll()
+	f.gtkApp.AddWindow(f.gui.MainWindow)
+
+	f.app.StartupAsync(mopidyCmdPath)
+}
+
+// registerActions() wires up the app- and window-scoped actions that back
+// wetsuit's menu items, so they can be bound from the .ui file and given
+// keyboard shortcuts.
+func (f *gtkFrontend) registerActions() {
+	f.AddWindowAction("menu-quit", []string{"<Primary>q"}, f.app.QuitCallback)
+	f.AddWindowAction("menu-server-output", nil, f.app.OutputWindowCallback)
+	f.AddAppAction("menu-server-start", nil, f.app.StartMopidyCallback)
+	f.AddAppAction("menu-server-stop", nil, f.app.StopMopidyCallback)
+	f.AddAppAction("menu-server-restart", nil, f.app.RestartMopidyCallback)
+	f.AddAppAction("menu-sources", nil, f.app.SourcesCallback)
+}
+
+// AddAppAction() registers a GAction on the GtkApplication itself, so it's
+// reachable as "app.<name>" from menus and the optional accels.
+func (f *gtkFrontend) AddAppAction(name string, accels []string, handler func()) {
+	action := glib.SimpleActionNew(name, nil)
+	action.Connect("activate", func() { handler() })
+	f.gtkApp.AddAction(action)
+	if len(accels) > 0 {
+		f.gtkApp.SetAccelsForAction("app."+name, accels)
+	}
+}
+
+// AddWindowAction() registers a GAction on the main window, so it's reachable
+// as "win.<name>" and is automatically inactive while no window is open.
+func (f *gtkFrontend) AddWindowAction(name string, accels []string, handler func()) {
+	action := glib.SimpleActionNew(name, nil)
+	action.Connect("activate", func() { handler() })
+	f.gui.MainWindow.AddAction(action)
+	if len(accels) > 0 {
+		f.gtkApp.SetAccelsForAction("win."+name, accels)
+	}
+}
+
+// NewModalDialog() creates a message dialog transient for the main window, so
+// it stays above and centered on wetsuit instead of floating unparented.
+func (f *gtkFrontend) NewModalDialog(messageType gtk.MessageType, buttons gtk.ButtonsType, msg string) *gtk.MessageDialog {
+	var parent *gtk.Window
+	if f.gui != nil {
+		parent = &f.gui.MainWindow.Window
+	}
+	dialog := gtk.MessageDialogNew(parent, gtk.DIALOG_MODAL, messageType, buttons, msg)
+	if parent != nil {
+		dialog.SetTransientFor(parent)
+	}
+	return dialog
+}
+
+// RunOnUIThread() marshals fn onto the GTK thread via glib.IdleAdd.
+func (f *gtkFrontend) RunOnUIThread(fn func()) {
+	glib.IdleAdd(fn)
+}
+
+// OutputWriter() returns nil: the GTK frontend's output window is fed
+// directly by gui.Gui rather than through Frontend.
+func (f *gtkFrontend) OutputWriter() io.Writer {
+	return nil
+}
+
+// SetStatus() updates the Gui's status line based on the value of status.
+func (f *gtkFrontend) SetStatus(status MopidyStatus) {
+	f.RunOnUIThread(func() {
+		switch status {
+		case MopidyConnecting:
+			f.gui.SetStatus("", "Connecting...")
+		case MopidyConnected:
+			f.gui.SetStatus(gtk.STOCK_CONNECT, "Connected to Mopidy.")
+		case MopidyFailed:
+			f.gui.SetStatus("", "Not connected.")
+		}
+	})
+}
+
+// ShowError() displays an error dialog and disables server controls when it
+// is shown; closing the dialog does not re-enable them. Errors
+// that arrive while one is already showing are dropped rather than stacking
+// another dialog on top.
+func (f *gtkFrontend) ShowError(err error) {
+	f.RunOnUIThread(func() {
+		if f.showingError {
+			return
+		}
+		f.showingError = true
+		f.app.Disable()
+		dialog := f.NewModalDialog(gtk.MESSAGE_ERROR, gtk.BUTTONS_CLOSE, err.Error())
+		dialog.Connect("response", func() {
+			dialog.Destroy()
+			f.showingError = false
+		})
+		dialog.Show()
+	})
+}
+
+// PromptRestart() shows a non-modal InfoBar in the main window offering to
+// run onRestart, without interrupting whatever the user is doing.
+func (f *gtkFrontend) PromptRestart(message string, onRestart func()) {
+	f.RunOnUIThread(func() {
+		f.gui.ShowInfoBar(message, "Restart Mopidy", onRestart)
+	})
+}
+
+// Quit() asks the GtkApplication to quit on the GTK thread.
+func (f *gtkFrontend) Quit() {
+	f.RunOnUIThread(func() { f.gtkApp.Quit() })
+}
+
+// fatal() reports a startup error that happened before a frontend was wired
+// up to receive it, then exits.
+func fatal(err error) {
+	dialog := gtk.MessageDialogNew(nil, 0, gtk.MESSAGE_ERROR, gtk.BUTTONS_CLOSE, err.Error())
+	dialog.Connect("response", func() {
+		gtk.MainQuit()
+		signal.Reset()
+		os.Exit(1)
+	})
+	dialog.Show()
+	if gtk.MainLevel() == 0 {
+		gtk.Main()
+	}
+}
@@ -1,29 +1,49 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"github.com/dradtke/gotk3/gtk"
+	"flag"
 	"github.com/dradtke/wetsuit/config"
-	"github.com/dradtke/wetsuit/gui"
 	"os"
 	"os/exec"
+	"os/signal"
 	"os/user"
 	"path/filepath"
 	"runtime"
 	"sync"
+	"syscall"
+	"time"
 )
 
+// mopidyShutdownTimeout is how long shutdownMopidy() waits for mopidy to exit after
+// SIGTERM before giving up and killing it outright.
+const mopidyShutdownTimeout = 5 * time.Second
+
+// errMopidyNotInstalled is returned by bootstrap() when mopidy isn't on PATH,
+// shared so both frontends report the exact same message.
+var errMopidyNotInstalled = errors.New("Mopidy is not installed.")
+
+// Application holds wetsuit's state machine: mopidy's lifecycle, the current
+// configuration, and the error/status/quit streams that drive the UI. It
+// doesn't know or care whether it's being driven by the GTK frontend or the
+// TUI; both talk to it through Frontend, the exported callbacks, and the
+// shared startup helpers (SetFrontend, bootstrap, StartupAsync).
 type Application struct {
-	Mopidy *MopidyProc
-	Config *config.Properties
-	Gui    *gui.Gui
+	Mopidy     *MopidyProc
+	Config     *config.Properties
+	ConfigPath string
 
-	Errors       chan error // channel of errors to be displayed
-	ShowingError bool
+	Frontend      Frontend
+	frontendReady chan struct{} // closed once Frontend has been assigned
 
-	Work chan func() // channel of functions to be run in the main thread
+	Ctx    context.Context
+	Cancel context.CancelFunc
+
+	Errors        chan error        // errors to be displayed by the frontend
+	StatusChanges chan MopidyStatus // mopidy status transitions to be reflected by the frontend
+	quit          chan struct{}     // signals that the application should shut down
 
-	Running    bool
 	StatusLock sync.Mutex
 }
 
@@ -32,149 +52,194 @@ func main() {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
+	tui := flag.Bool("tui", false, "run as a headless TUI instead of opening a GTK window")
+	flag.Parse()
+
 	app := new(Application)
 	app.Errors = make(chan error)
-	app.Work = make(chan func())
-	app.Running = true
+	app.StatusChanges = make(chan MopidyStatus)
+	app.quit = make(chan struct{}, 1)
+	app.frontendReady = make(chan struct{})
+	app.Ctx, app.Cancel = context.WithCancel(context.Background())
 
-	gtk.Init(nil)
-	var mopidyCmdPath, userConfigPath string
+	go app.watchErrors()
+	go app.watchStatus()
+	go app.watchQuit()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			switch sig {
+			case syscall.SIGHUP:
+				if err := app.ReloadConfig(); err != nil {
+					app.Errors <- err
+				}
+			default:
+				app.Quit()
+			}
+		}
+	}()
+
+	if *tui {
+		runTUI(app)
+	} else {
+		runGTK(app)
+	}
+}
 
-	// make sure mopidy is installed
-	mopidyCmdPath, err := exec.LookPath("mopidy")
+// bootstrap() finds the mopidy binary, loads the user's configuration, and
+// starts watching it for changes. It's shared by both frontends, since
+// neither step depends on how the result gets displayed.
+func (app *Application) bootstrap() (mopidyCmdPath string, err error) {
+	mopidyCmdPath, err = exec.LookPath("mopidy")
 	if err != nil {
-		app.Fatal(errors.New("Mopidy is not installed."))
+		return "", errMopidyNotInstalled
 	}
 
-	// find the user's configuration
 	usr, err := user.Current()
-	if err == nil {
-		userConfigPath = filepath.Join(usr.HomeDir, ".config", "wetsuit", "mopidy.conf")
-	} else {
-		// no user =/
-		app.Fatal(err)
+	if err != nil {
+		return "", err
 	}
+	app.ConfigPath = filepath.Join(usr.HomeDir, ".config", "wetsuit", "mopidy.conf")
 
-	// load configuration
-	if p, err := config.Load(userConfigPath); err == nil {
-		app.Config = p
-	} else {
-		app.Fatal(err)
+	p, err := config.Load(app.ConfigPath)
+	if err != nil {
+		return "", err
 	}
+	app.Config = p
 
-	// create the window
-	app.Gui, err = gui.Init(app.Config, app.Callbacks())
-	if err != nil {
-		app.Fatal(err)
+	if err := app.WatchConfig(); err != nil {
+		app.Errors <- err
 	}
 
-	app.Gui.MainWindow.ShowAll()
+	return mopidyCmdPath, nil
+}
+
+// StartupAsync() runs mopidy's init-and-start sequence asynchronously,
+// shared by both frontends once they've finished their own setup. mopidy's
+// stdout/stderr are copied to app.Frontend.OutputWriter(), if the frontend
+// has a use for them.
+func (app *Application) StartupAsync(mopidyCmdPath string) {
+	app.Async(func() (func(), error) {
+		if err := app.InitMopidy(app.Ctx, mopidyCmdPath, app.Frontend.OutputWriter()); err != nil {
+			return nil, err
+		}
+		// attempt to start mopidy
+		app.StartMopidy()
+		return nil, nil
+	})
+}
 
+// Async() runs fn on a goroutine, then marshals its returned closure back
+// onto the frontend's UI thread once it completes. If fn returns a non-nil
+// error instead, that error is routed to the Errors channel rather than run.
+// Nothing in fn's goroutine may touch UI state directly.
+func (app *Application) Async(fn func() (func(), error)) {
 	go func() {
-		err := app.InitMopidy(mopidyCmdPath)
+		cb, err := fn()
 		if err != nil {
 			app.Errors <- err
+			return
+		}
+		if cb != nil {
+			app.Frontend.RunOnUIThread(cb)
 		}
-		// attempt to start mopidy
-		app.StartMopidy()
 	}()
+}
 
-	// custom iterator so that we can watch channels
-	for app.Running {
-		gtk.MainIteration()
-
-		// check for main thread work
-		select {
-		case f := <-app.Work:
-			f()
-		default:
-			// fall through
-		}
+// SetFrontend() records the frontend that's now driving the application and
+// unblocks any goroutine waiting in waitForFrontend(). Must be called
+// exactly once, before signals, errors, or status changes can reach it.
+func (app *Application) SetFrontend(f Frontend) {
+	app.Frontend = f
+	close(app.frontendReady)
+}
 
-		// if no error is currently showing, check for
-		// error messages to display
-		if !app.ShowingError {
-			select {
-			case err := <-app.Errors:
-				app.ShowingError = true
-				app.NonFatal(err)
-				app.Disable()
-			default:
-				// fall through
-			}
-		}
-	}
+// waitForFrontend() blocks until SetFrontend has been called, so that a
+// signal or error arriving during startup - before activate()/runTUI have
+// wired up a Frontend - can't dereference a nil one.
+func (app *Application) waitForFrontend() {
+	<-app.frontendReady
 }
 
-// Fatal() displays an error dialog, then quits the program when it's closed.
-func (app *Application) Fatal(err error) {
-	dialog := gtk.MessageDialogNew(nil, 0, gtk.MESSAGE_ERROR, gtk.BUTTONS_CLOSE, err.Error())
-	dialog.Connect("response", func() {
-		gtk.MainQuit()
-		os.Exit(1)
-	})
-	dialog.Show()
-	if gtk.MainLevel() == 0 {
-		gtk.Main()
+// watchErrors() drains the Errors channel for the lifetime of the
+// application, handing each one to the frontend to display.
+func (app *Application) watchErrors() {
+	for err := range app.Errors {
+		app.waitForFrontend()
+		app.Frontend.ShowError(err)
 	}
 }
 
-// NonFatal() displays an error dialog, but the program keeps running after it's closed.
-// This should not be called from anywhere but main(), since it needs to run on GTK's thread.
-func (app *Application) NonFatal(err error) {
-	dialog := gtk.MessageDialogNew(nil, 0, gtk.MESSAGE_ERROR, gtk.BUTTONS_CLOSE, err.Error())
-	dialog.Connect("response", func() {
-		dialog.Destroy()
-		app.ShowingError = false
-	})
-	dialog.Show()
+// watchStatus() drains mopidy status transitions and hands them to the
+// frontend, keeping SetStatus() itself safe to call from any goroutine.
+func (app *Application) watchStatus() {
+	for status := range app.StatusChanges {
+		app.waitForFrontend()
+		app.Frontend.SetStatus(status)
+	}
 }
 
-// Do() runs a function in the main thread, waiting until it finishes.
-func (app *Application) Do(f func()) {
-	done := make(chan bool, 1)
-	app.Work <- func() {
-		f()
-		done <- true
-	}
-	<-done
+// watchQuit() waits for a quit signal, tears down mopidy and the signal
+// handlers, then asks the frontend to quit.
+func (app *Application) watchQuit() {
+	<-app.quit
+	app.shutdownMopidy()
+	app.Cancel()
+	signal.Reset()
+	app.waitForFrontend()
+	app.Frontend.Quit()
 }
 
-// SetStatus() updates the Gui's status based on the value of the provided enum.
+// SetStatus() records mopidy's new status and queues it to be reflected by
+// the frontend. Safe to call from any goroutine.
 func (app *Application) SetStatus(status MopidyStatus) {
 	app.StatusLock.Lock()
-	defer app.StatusLock.Unlock()
-
 	app.Mopidy.Status = status
-	switch status {
-	case MopidyConnecting:
-		app.Gui.SetStatus("", "Connecting...")
-	case MopidyConnected:
-		app.Gui.SetStatus(gtk.STOCK_CONNECT, "Connected to Mopidy.")
-	case MopidyFailed:
-		app.Gui.SetStatus("", "Not connected.")
-	}
+	app.StatusLock.Unlock()
+
+	app.StatusChanges <- status
 }
 
-// Quit() quits the application.
+// Quit() requests that the application shut down. Safe to call from any
+// goroutine, including a signal handler; redundant calls are dropped rather
+// than blocking.
 func (app *Application) Quit() {
-	if app.Mopidy.Cmd.Process != nil {
-		app.Mopidy.Cmd.Process.Kill()
+	select {
+	case app.quit <- struct{}{}:
+	default:
+	}
+}
+
+// shutdownMopidy() asks the mopidy child process to terminate gracefully by
+// sending SIGTERM and giving it mopidyShutdownTimeout to flush its state
+// before falling back to an unconditional Kill().
+func (app *Application) shutdownMopidy() {
+	if app.Mopidy == nil || app.Mopidy.Cmd.Process == nil {
+		return
+	}
+	proc := app.Mopidy.Cmd.Process
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		proc.Kill()
+		return
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- app.Mopidy.Cmd.Wait() }()
+
+	select {
+	case <-done:
+	case <-time.After(mopidyShutdownTimeout):
+		proc.Kill()
 	}
-	app.Running = false
 }
 
-// Callbacks() returns a map from widget name and signal to callback function.
-// It's used during Gui initialization to make all the necessary connections.
-func (app *Application) Callbacks() (cb map[string]map[string]gui.Callback) {
-	cb = make(map[string]map[string]gui.Callback)
-	cb["main-window"] = map[string]gui.Callback{"destroy": app.QuitCallback}
-	cb["menu-quit"] = map[string]gui.Callback{"activate": app.QuitCallback}
-	cb["menu-server-output"] = map[string]gui.Callback{"activate": app.OutputWindowCallback}
-	cb["menu-server-start"] = map[string]gui.Callback{"activate": app.StartMopidyCallback}
-	cb["menu-server-stop"] = map[string]gui.Callback{"activate": app.StopMopidyCallback}
-	cb["menu-server-restart"] = map[string]gui.Callback{"activate": app.RestartMopidyCallback}
-	cb["menu-sources"] = map[string]gui.Callback{"activate": app.SourcesCallback}
-	cb["output-window"] = map[string]gui.Callback{"delete-event": app.OutputWindowDeleteCallback}
-	return
+// ReloadConfig() re-reads the configuration file from disk, as requested by
+// a SIGHUP. It routes through reloadConfigFile so a SIGHUP can't race the
+// fsnotify watcher over app.Config, and gets the same diff/restart-prompt
+// treatment as a file-change reload.
+func (app *Application) ReloadConfig() error {
+	app.reloadConfigFile()
+	return nil
 }
@@ -0,0 +1,212 @@
+// Package tui implements a headless frontend for wetsuit built on gocui, for
+// running on a music server over SSH where there's no display to put a GTK
+// window on.
+package tui
+
+import (
+	"fmt"
+	"github.com/jroimartin/gocui"
+	"io"
+	"sync"
+)
+
+// Callbacks is the set of actions the TUI's keybindings invoke. It mirrors
+// the GTK frontend's menu actions so both frontends drive the same
+// Application methods.
+type Callbacks struct {
+	Quit          func()
+	StartMopidy   func()
+	StopMopidy    func()
+	RestartMopidy func()
+	OutputWindow  func()
+	Sources       func()
+}
+
+// TUI is a gocui-backed frontend: a status bar, a scrollable output pane,
+// and a help line showing the keybindings below.
+type TUI struct {
+	gui *gocui.Gui
+	cb  Callbacks
+
+	mu     sync.Mutex
+	status string
+}
+
+// New() builds a TUI and binds its keyboard shortcuts, but doesn't start its
+// event loop; call Run() for that.
+func New(cb Callbacks) (*TUI, error) {
+	g, err := gocui.NewGui(gocui.OutputNormal)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TUI{gui: g, cb: cb, status: "Not connected."}
+	g.SetManagerFunc(t.layout)
+
+	if err := t.bindKeys(); err != nil {
+		g.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// layout() lays out the status bar, output pane, and help line top to
+// bottom, and is re-run by gocui on every resize.
+func (t *TUI) layout(g *gocui.Gui) error {
+	maxX, maxY := g.Size()
+
+	if v, err := g.SetView("status", 0, 0, maxX-1, 2); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "wetsuit"
+	}
+
+	if v, err := g.SetView("output", 0, 3, maxX-1, maxY-2); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "mopidy output"
+		v.Autoscroll = true
+		v.Wrap = true
+	}
+
+	if v, err := g.SetView("help", 0, maxY-2, maxX-1, maxY); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = false
+		fmt.Fprint(v, " q:quit  s:start  x:stop  r:restart  o:output  c:sources")
+	}
+
+	t.drawStatus()
+	return nil
+}
+
+// drawStatus() repaints the status view with the last status set via
+// SetStatus(). Must be called with the gocui layout already holding its own
+// lock (i.e. from within the manager func or an Update callback).
+func (t *TUI) drawStatus() {
+	v, err := t.gui.View("status")
+	if err != nil {
+		return
+	}
+	v.Clear()
+	t.mu.Lock()
+	fmt.Fprintf(v, " %s", t.status)
+	t.mu.Unlock()
+}
+
+// bindKeys() wires up q/s/x/r/o/c to the matching Callbacks field, plus
+// Enter to dismiss the error view when one is showing.
+func (t *TUI) bindKeys() error {
+	bindings := []struct {
+		key     interface{}
+		handler func(*gocui.Gui, *gocui.View) error
+	}{
+		{'q', func(*gocui.Gui, *gocui.View) error { t.cb.Quit(); return nil }},
+		{'s', func(*gocui.Gui, *gocui.View) error { t.cb.StartMopidy(); return nil }},
+		{'x', func(*gocui.Gui, *gocui.View) error { t.cb.StopMopidy(); return nil }},
+		{'r', func(*gocui.Gui, *gocui.View) error { t.cb.RestartMopidy(); return nil }},
+		{'o', func(*gocui.Gui, *gocui.View) error { t.cb.OutputWindow(); return nil }},
+		{'c', func(*gocui.Gui, *gocui.View) error { t.cb.Sources(); return nil }},
+		{gocui.KeyEnter, t.dismissError},
+	}
+	for _, b := range bindings {
+		if err := t.gui.SetKeybinding("", b.key, gocui.ModNone, b.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TUI) dismissError(g *gocui.Gui, v *gocui.View) error {
+	if err := g.DeleteView("error"); err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	return nil
+}
+
+// Run() blocks until the TUI is closed, either by the q keybinding calling
+// Quit() or by Close() being called from elsewhere.
+func (t *TUI) Run() error {
+	defer t.gui.Close()
+	if err := t.gui.MainLoop(); err != nil && err != gocui.ErrQuit {
+		return err
+	}
+	return nil
+}
+
+// Close() stops the TUI's event loop and releases the terminal.
+func (t *TUI) Close() {
+	t.gui.Update(func(g *gocui.Gui) error { return gocui.ErrQuit })
+}
+
+// Update() schedules fn to run on gocui's own goroutine, which is the only
+// place it's safe to touch views from.
+func (t *TUI) Update(fn func()) {
+	t.gui.Update(func(g *gocui.Gui) error {
+		fn()
+		return nil
+	})
+}
+
+// SetStatus() updates the text shown in the status bar.
+func (t *TUI) SetStatus(text string) {
+	t.mu.Lock()
+	t.status = text
+	t.mu.Unlock()
+
+	t.Update(t.drawStatus)
+}
+
+// ShowError() pops up a modal view in the center of the screen describing
+// msg; press Enter to dismiss it.
+func (t *TUI) ShowError(msg string) {
+	t.Update(func() {
+		maxX, maxY := t.gui.Size()
+		v, err := t.gui.SetView("error", maxX/2-30, maxY/2-3, maxX/2+30, maxY/2+3)
+		if err != nil && err != gocui.ErrUnknownView {
+			return
+		}
+		v.Title = "Error (press Enter to dismiss)"
+		v.Clear()
+		fmt.Fprintln(v, msg)
+		t.gui.SetViewOnTop("error")
+		t.gui.SetCurrentView("error")
+	})
+}
+
+// PromptRestart() replaces the help line with message, reminding the user
+// that r restarts mopidy; RestartMopidy is already bound to that key.
+func (t *TUI) PromptRestart(message string) {
+	t.Update(func() {
+		v, err := t.gui.View("help")
+		if err != nil {
+			return
+		}
+		v.Clear()
+		fmt.Fprintf(v, " %s (r:restart)", message)
+	})
+}
+
+// OutputWriter() returns a writer that appends to the scrollable output
+// pane, meant to be fed by MopidyProc's stdout/stderr.
+func (t *TUI) OutputWriter() io.Writer {
+	return outputWriter{t}
+}
+
+type outputWriter struct{ t *TUI }
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	buf := append([]byte(nil), p...)
+	w.t.Update(func() {
+		v, err := w.t.gui.View("output")
+		if err != nil {
+			return
+		}
+		v.Write(buf)
+	})
+	return len(p), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dradtke/wetsuit/tui"
+	"io"
+	"os"
+)
+
+// tuiFrontend implements Frontend on top of a gocui-based TUI, translating
+// Application's typed status and error values into the plain strings the
+// tui package deals in.
+type tuiFrontend struct {
+	tui *tui.TUI
+}
+
+// runTUI() builds the TUI, wires it up to app, and blocks for the lifetime
+// of the process.
+func runTUI(app *Application) {
+	front := &tuiFrontend{}
+
+	t, err := tui.New(tui.Callbacks{
+		Quit:          app.QuitCallback,
+		StartMopidy:   app.StartMopidyCallback,
+		StopMopidy:    app.StopMopidyCallback,
+		RestartMopidy: app.RestartMopidyCallback,
+		OutputWindow:  app.OutputWindowCallback,
+		Sources:       app.SourcesCallback,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	front.tui = t
+	app.SetFrontend(front)
+
+	mopidyCmdPath, err := app.bootstrap()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	app.StartupAsync(mopidyCmdPath)
+
+	if err := front.tui.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// RunOnUIThread() marshals fn onto gocui's goroutine.
+func (f *tuiFrontend) RunOnUIThread(fn func()) {
+	f.tui.Update(fn)
+}
+
+// OutputWriter() returns the writer that feeds the TUI's scrollable output
+// pane, so mopidy's stdout/stderr can be copied to it.
+func (f *tuiFrontend) OutputWriter() io.Writer {
+	return f.tui.OutputWriter()
+}
+
+// SetStatus() reflects a mopidy status transition in the TUI's status bar.
+func (f *tuiFrontend) SetStatus(status MopidyStatus) {
+	switch status {
+	case MopidyConnecting:
+		f.tui.SetStatus("Connecting...")
+	case MopidyConnected:
+		f.tui.SetStatus("Connected to Mopidy.")
+	case MopidyFailed:
+		f.tui.SetStatus("Not connected.")
+	}
+}
+
+// ShowError() pops up a modal view describing err.
+func (f *tuiFrontend) ShowError(err error) {
+	f.tui.ShowError(err.Error())
+}
+
+// PromptRestart() surfaces message in the help line; r is already bound to
+// onRestart via the Callbacks passed to tui.New.
+func (f *tuiFrontend) PromptRestart(message string, onRestart func()) {
+	f.tui.PromptRestart(message)
+}
+
+// Quit() stops the TUI's event loop.
+func (f *tuiFrontend) Quit() {
+	f.tui.Close()
+}